@@ -5,13 +5,55 @@
 package illumina
 
 import (
+	"errors"
+	"sort"
+
 	"github.com/biogo/biogo/alphabet"
 	"github.com/biogo/biogo/seq"
 	"github.com/biogo/biogo/seq/quality"
 )
 
+// ErrBadScheme is returned when the bins given to NewScheme do not form a set
+// of non-overlapping ranges that monotonically cover 0..255.
+var ErrBadScheme = errors.New("illumina: invalid compression scheme")
+
 type Scheme *[256]alphabet.Qphred
 
+// A Bin describes the quality values mapped to Q by the range [Lo, Hi] of a
+// compression Scheme, as passed to NewScheme.
+type Bin struct {
+	Lo, Hi int
+	Q      alphabet.Qphred
+}
+
+// NewScheme constructs a Scheme from bins, a set of quality ranges and the
+// score each is compressed to. The bins may be given in any order, but once
+// sorted by Lo they must be contiguous and non-overlapping, starting at 0 and
+// ending at 255; otherwise NewScheme returns ErrBadScheme.
+func NewScheme(bins []Bin) (Scheme, error) {
+	if len(bins) == 0 {
+		return nil, ErrBadScheme
+	}
+	sorted := append([]Bin(nil), bins...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Lo < sorted[j].Lo })
+
+	var cs [256]alphabet.Qphred
+	next := 0
+	for _, b := range sorted {
+		if b.Lo != next || b.Hi < b.Lo || b.Hi > 255 {
+			return nil, ErrBadScheme
+		}
+		for i := b.Lo; i <= b.Hi; i++ {
+			cs[i] = b.Q
+		}
+		next = b.Hi + 1
+	}
+	if next != 256 {
+		return nil, ErrBadScheme
+	}
+	return &cs, nil
+}
+
 // DefaultCompression uses the quality compression scheme described in the Illumina
 // white paper :
 //   Old Quality Score   New Quality score
@@ -50,6 +92,131 @@ var defaultCompression = func() Scheme {
 	return &cs
 }()
 
+// NovaSeqCompression uses the 4-level quality compression scheme produced by
+// NovaSeq and NextSeq instruments running RTA3, binning to the representative
+// scores 12, 23 and 37:
+//   Old Quality Score   New Quality score
+//          0-1            preserved
+//          2–14               12
+//         15–30               23
+//          ≥ 31               37
+var NovaSeqCompression Scheme = novaSeqCompression
+
+var novaSeqCompression = mustScheme([]Bin{
+	{Lo: 0, Hi: 0, Q: 0},
+	{Lo: 1, Hi: 1, Q: 1},
+	{Lo: 2, Hi: 14, Q: 12},
+	{Lo: 15, Hi: 30, Q: 23},
+	{Lo: 31, Hi: 255, Q: 37},
+})
+
+// NextSeq2BinCompression uses the 2-level quality compression scheme produced
+// by 2-channel instruments such as the NextSeq and MiniSeq, binning to the
+// representative scores 12 and 37 either side of Q20:
+//   Old Quality Score   New Quality score
+//          0-1            preserved
+//          2–19               12
+//          ≥ 20               37
+var NextSeq2BinCompression Scheme = nextSeq2BinCompression
+
+var nextSeq2BinCompression = mustScheme([]Bin{
+	{Lo: 0, Hi: 0, Q: 0},
+	{Lo: 1, Hi: 1, Q: 1},
+	{Lo: 2, Hi: 19, Q: 12},
+	{Lo: 20, Hi: 255, Q: 37},
+})
+
+// mustScheme is used to build the package-level Scheme values from literal
+// bins that are known to be valid; it panics if they are not.
+func mustScheme(bins []Bin) Scheme {
+	s, err := NewScheme(bins)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// SchemeFromReads derives a Scheme with at most nBins bins from the quality
+// scores observed in r, choosing cutpoints by equal-mass binning of the quality
+// histogram so that each bin covers approximately the same number of bases.
+// Cutpoints fall only at observed quality values, so fewer than nBins bins are
+// produced when fewer distinct qualities are observed.
+// Each bin is compressed to the mean quality of the scores it covers. If r
+// contains no scored bases or nBins is not positive, DefaultCompression is
+// returned.
+func SchemeFromReads(r []seq.Scorer, nBins int) Scheme {
+	var hist [256]int
+	for _, s := range r {
+		if sl, ok := s.(seq.Slicer); ok {
+			switch d := sl.Slice().(type) {
+			case alphabet.QLetters:
+				for _, ql := range d {
+					hist[ql.Q]++
+				}
+				continue
+			case quality.Qphreds:
+				for _, q := range d {
+					hist[q]++
+				}
+				continue
+			}
+		}
+		for i := s.Start(); i < s.End(); i++ {
+			hist[int(alphabet.Ephred(s.EAt(i)))]++
+		}
+	}
+
+	total := 0
+	for _, n := range hist {
+		total += n
+	}
+	if total == 0 || nBins <= 0 {
+		return DefaultCompression
+	}
+
+	var observed []int
+	for q, n := range hist {
+		if n > 0 {
+			observed = append(observed, q)
+		}
+	}
+
+	// Split only at observed quality values, so that sparse histograms (few
+	// reads, or a few distinct quality levels relative to nBins) don't burn
+	// the bin budget on unobserved quality values before reaching real data.
+	target := total / nBins
+	bins := make([]Bin, 0, nBins)
+	lo, cum := 0, 0
+	for i, q := range observed {
+		cum += hist[q]
+		if cum >= target && len(bins) < nBins-1 && i < len(observed)-1 {
+			bins = append(bins, Bin{Lo: lo, Hi: q, Q: meanQuality(hist[:], lo, q)})
+			lo, cum = q+1, 0
+		}
+	}
+	bins = append(bins, Bin{Lo: lo, Hi: 255, Q: meanQuality(hist[:], lo, 255)})
+
+	s, err := NewScheme(bins)
+	if err != nil {
+		return DefaultCompression
+	}
+	return s
+}
+
+// meanQuality returns the count-weighted mean quality score observed in
+// hist over the inclusive range [lo, hi].
+func meanQuality(hist []int, lo, hi int) alphabet.Qphred {
+	var sum, n int
+	for q := lo; q <= hi; q++ {
+		sum += q * hist[q]
+		n += hist[q]
+	}
+	if n == 0 {
+		return alphabet.Qphred((lo + hi) / 2)
+	}
+	return alphabet.Qphred(sum / n)
+}
+
 // BinCompress lossily compresses the qualities of a seq.Scorer according to the
 // the provided compression Scheme, c. If c is nil, the default Scheme is used. The
 // approach used by BinCompress is described in the  Illumina whitepaper at
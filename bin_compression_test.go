@@ -0,0 +1,105 @@
+// Copyright ©2013 The bíogo.illumina Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package illumina
+
+import (
+	"gopkg.in/check.v1"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/seq"
+	"github.com/biogo/biogo/seq/linear"
+)
+
+func (s *S) TestNewScheme(c *check.C) {
+	for i, t := range []struct {
+		bins []Bin
+		ok   bool
+	}{
+		{nil, false},
+		{[]Bin{{Lo: 1, Hi: 255, Q: 0}}, false},                           // does not start at 0
+		{[]Bin{{Lo: 0, Hi: 200, Q: 0}}, false},                           // does not end at 255
+		{[]Bin{{Lo: 0, Hi: 100, Q: 0}, {Lo: 50, Hi: 255, Q: 1}}, false},  // overlap
+		{[]Bin{{Lo: 0, Hi: 100, Q: 0}, {Lo: 102, Hi: 255, Q: 1}}, false}, // gap
+		{[]Bin{{Lo: 0, Hi: 127, Q: 10}, {Lo: 128, Hi: 255, Q: 20}}, true},
+	} {
+		_, err := NewScheme(t.bins)
+		if t.ok {
+			c.Check(err, check.Equals, nil, check.Commentf("Test %d", i))
+		} else {
+			c.Check(err, check.Equals, ErrBadScheme, check.Commentf("Test %d", i))
+		}
+	}
+
+	sch, err := NewScheme([]Bin{{Lo: 0, Hi: 127, Q: 10}, {Lo: 128, Hi: 255, Q: 20}})
+	c.Assert(err, check.Equals, nil)
+	c.Check(sch[0], check.Equals, alphabet.Qphred(10))
+	c.Check(sch[127], check.Equals, alphabet.Qphred(10))
+	c.Check(sch[128], check.Equals, alphabet.Qphred(20))
+	c.Check(sch[255], check.Equals, alphabet.Qphred(20))
+}
+
+func (s *S) TestNovaSeqCompression(c *check.C) {
+	for i, t := range []struct {
+		q    int
+		want alphabet.Qphred
+	}{
+		{0, 0}, {1, 1}, {2, 12}, {14, 12}, {15, 23}, {30, 23}, {31, 37}, {255, 37},
+	} {
+		c.Check(NovaSeqCompression[t.q], check.Equals, t.want, check.Commentf("Test %d", i))
+	}
+}
+
+func (s *S) TestNextSeq2BinCompression(c *check.C) {
+	for i, t := range []struct {
+		q    int
+		want alphabet.Qphred
+	}{
+		{0, 0}, {1, 1}, {2, 12}, {19, 12}, {20, 37}, {255, 37},
+	} {
+		c.Check(NextSeq2BinCompression[t.q], check.Equals, t.want, check.Commentf("Test %d", i))
+	}
+}
+
+// read builds a minimal linear.QSeq carrying the given qualities over a
+// matching run of 'A' bases, for driving SchemeFromReads in tests.
+func read(qs ...int) seq.Scorer {
+	letters := make(alphabet.QLetters, len(qs))
+	for i, v := range qs {
+		letters[i] = alphabet.QLetter{L: 'A', Q: alphabet.Qphred(v)}
+	}
+	return linear.NewQSeq("", letters, alphabet.DNA, alphabet.Sanger)
+}
+
+func (s *S) TestSchemeFromReadsSparse(c *check.C) {
+	// Four reads with four distinct qualities and a bin budget far larger
+	// than the number of distinct values: every observed value gets its own
+	// bin and the bin budget isn't wasted on unobserved qualities.
+	reads := []seq.Scorer{read(10), read(20), read(30), read(40)}
+	sch := SchemeFromReads(reads, 10)
+	c.Check(sch[10], check.Equals, alphabet.Qphred(10))
+	c.Check(sch[20], check.Equals, alphabet.Qphred(20))
+	c.Check(sch[30], check.Equals, alphabet.Qphred(30))
+	c.Check(sch[40], check.Equals, alphabet.Qphred(40))
+	c.Check(sch[255], check.Equals, alphabet.Qphred(40))
+}
+
+func (s *S) TestSchemeFromReadsDense(c *check.C) {
+	var reads []seq.Scorer
+	for i := 0; i < 10; i++ {
+		reads = append(reads, read(10))
+	}
+	for i := 0; i < 10; i++ {
+		reads = append(reads, read(30))
+	}
+	sch := SchemeFromReads(reads, 2)
+	c.Check(sch[10], check.Equals, alphabet.Qphred(10))
+	c.Check(sch[11], check.Equals, alphabet.Qphred(30))
+	c.Check(sch[30], check.Equals, alphabet.Qphred(30))
+}
+
+func (s *S) TestSchemeFromReadsEmpty(c *check.C) {
+	c.Check(SchemeFromReads(nil, 4), check.Equals, DefaultCompression)
+	c.Check(SchemeFromReads([]seq.Scorer{read(10)}, 0), check.Equals, DefaultCompression)
+}
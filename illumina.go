@@ -8,6 +8,7 @@ package illumina
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 
@@ -34,6 +35,8 @@ func (t Type) String() string {
 		return "pre-casava"
 	case Casava:
 		return "casava"
+	case CasavaUMI:
+		return "casava-umi"
 	}
 	return "invalid"
 }
@@ -42,6 +45,9 @@ const (
 	Undefined Type = iota
 	PreCasava
 	Casava
+	// CasavaUMI is a Casava identifier extended with a unique molecular
+	// identifier in an 8th name field, as emitted by some modern pipelines.
+	CasavaUMI
 )
 
 // A Coordinate represents a cluster location in an Illumina flow-cell lane.
@@ -52,7 +58,8 @@ type Coordinate struct {
 // A Multiplex represents multiplexing tag information.
 type Multiplex struct {
 	Index int8   // Index is -1 if not valid.
-	Tag   string // Tag is empty if not valid.
+	Tag   string // Tag is empty if not valid. Holds the i7 index of a dual-indexed tag.
+	Tag2  string // Tag2 is the i5 index of a dual-indexed tag, taken from the "i7+i5" form. Empty if not valid.
 }
 
 // A Metadata represents Illumina read metadata.
@@ -64,6 +71,7 @@ type Metadata struct {
 	Lane        int8       // Flowcell lane.
 	Tile        int        // Tile number within the flowcell lane.
 	Coordinate  Coordinate // Coordinate of the cluster within the tile.
+	UMI         string     // Unique molecular identifier, empty if not valid.
 	Mate        int8       // Member of a pair, 1 or 2 for paired reads.
 	BadRead     bool       // Read failed filter.
 	ControlBits int        // 0 when none of the control bits are on, otherwise it is an even number, -1 if not valid.
@@ -82,6 +90,96 @@ func Parse(r Interface) (Metadata, error) {
 	return casava(name, desc)
 }
 
+// Format reconstructs the name and description fields of an Illumina identifier
+// from m, selecting the pre-Casava or Casava layout according to m.Type. The
+// description is omitted (returned as the empty string) when m.Mate, m.ControlBits
+// and m.Multiplex are all unset, matching the trimmed identifiers accepted by Parse.
+// Format returns ErrBadIdentifer if m.Type is not PreCasava, Casava or CasavaUMI,
+// or if a tag field must be written (always for PreCasava, and for Casava whenever
+// the description is not omitted) and m.Multiplex has neither a valid Index nor a
+// tag. It returns ErrBadTag if the tag or m.UMI is not valid.
+func (m Metadata) Format() (name, desc string, err error) {
+	switch m.Type {
+	case PreCasava:
+		return m.formatPreCasava()
+	case Casava, CasavaUMI:
+		return m.formatCasava()
+	}
+	return "", "", ErrBadIdentifer
+}
+
+// FormatInto writes the identifier for m to w, joining the name and description
+// with a space in the same way they are split by Parse. If m has no description,
+// only the name is written.
+func (m Metadata) FormatInto(w io.Writer) error {
+	name, desc, err := m.Format()
+	if err != nil {
+		return err
+	}
+	if desc == "" {
+		_, err = io.WriteString(w, name)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s %s", name, desc)
+	return err
+}
+
+func (m Metadata) formatPreCasava() (name, desc string, err error) {
+	var tag string
+	switch {
+	case m.Multiplex.Index >= 0:
+		tag = strconv.Itoa(int(m.Multiplex.Index))
+	case m.Multiplex.Tag != "":
+		if !tagOk(m.Multiplex.Tag) {
+			return "", "", ErrBadTag
+		}
+		tag = m.Multiplex.Tag
+	default:
+		return "", "", ErrBadIdentifer
+	}
+	name = fmt.Sprintf("%s:%d:%d:%d:%d#%s", m.Instrument, m.Lane, m.Tile, m.Coordinate.X, m.Coordinate.Y, tag)
+	if m.Mate != 0 {
+		name += fmt.Sprintf("/%d", m.Mate)
+	}
+	return name, "", nil
+}
+
+func (m Metadata) formatCasava() (name, desc string, err error) {
+	var run string
+	if m.Run >= 0 {
+		run = strconv.Itoa(m.Run)
+	}
+	name = fmt.Sprintf("%s:%s:%s:%d:%d:%d:%d", m.Instrument, run, m.FlowCell, m.Lane, m.Tile, m.Coordinate.X, m.Coordinate.Y)
+	if m.Type == CasavaUMI || m.UMI != "" {
+		if !umiOk(m.UMI) {
+			return "", "", ErrBadTag
+		}
+		name += ":" + m.UMI
+	}
+	if m.Mate == 0 && m.ControlBits < 0 && m.Multiplex.Index < 0 && m.Multiplex.Tag == "" && m.Multiplex.Tag2 == "" {
+		return name, "", nil
+	}
+	tag := m.Multiplex.Tag
+	if tag == "" && m.Multiplex.Index >= 0 {
+		tag = strconv.Itoa(int(m.Multiplex.Index))
+	}
+	if m.Multiplex.Tag2 != "" {
+		tag += "+" + m.Multiplex.Tag2
+	}
+	if tag == "" {
+		return "", "", ErrBadIdentifer
+	}
+	if !tagOk(tag) {
+		return "", "", ErrBadTag
+	}
+	badRead := "N"
+	if m.BadRead {
+		badRead = "Y"
+	}
+	desc = fmt.Sprintf("%d:%s:%d:%s", m.Mate, badRead, m.ControlBits, tag)
+	return name, desc, nil
+}
+
 func mustAtoi(s string) int {
 	if len(s) == 0 {
 		return -1
@@ -101,8 +199,32 @@ func atob(s string) (int8, error) {
 	return int8(i), err
 }
 
+// tagOk reports whether tag is a valid multiplex tag: a DNA sequence, or a
+// pair of DNA sequences joined by '+' in the dual-index form "i7+i5".
 func tagOk(tag string) bool {
+	dual := false
 	for _, r := range tag {
+		if r == '+' {
+			if dual {
+				return false
+			}
+			dual = true
+			continue
+		}
+		if !alphabet.DNA.IsValid(alphabet.Letter(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// umiOk reports whether s is a valid unique molecular identifier: a DNA
+// sequence that may also contain N calls.
+func umiOk(s string) bool {
+	for _, r := range s {
+		if r == 'N' {
+			continue
+		}
 		if !alphabet.DNA.IsValid(alphabet.Letter(r)) {
 			return false
 		}
@@ -112,13 +234,13 @@ func tagOk(tag string) bool {
 
 // @HWUSI-EAS100R:6:73:941:1973#0/1
 //
-//  HWUSI-EAS100R 	the unique instrument name
-//  6 				flowcell lane
-//  73 				tile number within the flowcell lane
-//  941 			'x'-coordinate of the cluster within the tile
-//  1973		 	'y'-coordinate of the cluster within the tile
-//  #0 				index number for a multiplexed sample (0 for no indexing)
-//  /1 				the member of a pair, /1 or /2 (paired-end or mate-pair reads only)
+//	HWUSI-EAS100R 	the unique instrument name
+//	6 				flowcell lane
+//	73 				tile number within the flowcell lane
+//	941 			'x'-coordinate of the cluster within the tile
+//	1973		 	'y'-coordinate of the cluster within the tile
+//	#0 				index number for a multiplexed sample (0 for no indexing)
+//	/1 				the member of a pair, /1 or /2 (paired-end or mate-pair reads only)
 func preCasavaSep(r rune) bool { return r == ':' || r == '#' || r == '/' }
 func preCasava(name string) (m Metadata, err error) {
 	f := strings.FieldsFunc(name, preCasavaSep)
@@ -169,13 +291,26 @@ func preCasava(name string) (m Metadata, err error) {
 // Y 		Y if the read fails filter (read is bad), N otherwise
 // 18	 	0 when none of the control bits are on, otherwise it is an even number
 // ATCACG 	index sequence
+//
+// Some pipelines append an 8th name field carrying a unique molecular
+// identifier (e.g. ...:197393:NACGTNAC), and dual-indexed runs report the i7
+// and i5 index sequences joined by '+' in the tag field (e.g.
+// ATCACG+TGACCA). Identifiers using the former are reported as type
+// CasavaUMI.
+//
+// The name is split with strings.Split rather than strings.FieldsFunc since
+// the run field may be empty (Run == -1) and FieldsFunc collapses empty
+// fields, which would misalign every field after it.
 func casavaSep(r rune) bool { return r == ':' }
 func casava(name, desc string) (m Metadata, err error) {
-	nf := strings.FieldsFunc(name, casavaSep)
+	nf := strings.Split(name, ":")
 	df := strings.FieldsFunc(desc, casavaSep)
-	if !(len(nf) == 7 && (len(df) == 4 || desc == "")) {
+	if !((len(nf) == 7 || len(nf) == 8) && (len(df) == 4 || desc == "")) {
 		return Metadata{}, ErrBadIdentifer
 	}
+	if len(nf) == 8 && !umiOk(nf[7]) {
+		return Metadata{}, ErrBadTag
+	}
 	if len(df) == 4 && !tagOk(df[3]) {
 		return Metadata{}, ErrBadTag
 	}
@@ -186,14 +321,21 @@ func casava(name, desc string) (m Metadata, err error) {
 			m.Type = Undefined
 		}
 	}()
+	typ := Casava
+	var umi string
+	if len(nf) == 8 {
+		typ = CasavaUMI
+		umi = nf[7]
+	}
 	m = Metadata{
-		Type:        Casava,
+		Type:        typ,
 		Instrument:  nf[0],
 		Run:         mustAtoi(nf[1]),
 		FlowCell:    nf[2],
 		Lane:        int8(mustAtoi(nf[3])),
 		Tile:        mustAtoi(nf[4]),
 		Coordinate:  Coordinate{mustAtoi(nf[5]), mustAtoi(nf[6])},
+		UMI:         umi,
 		ControlBits: -1,
 		Multiplex:   Multiplex{Index: -1},
 	}
@@ -201,7 +343,12 @@ func casava(name, desc string) (m Metadata, err error) {
 		m.Mate = int8(mustAtoi(df[0]))
 		m.BadRead = df[1] == "Y" || df[1] == "y"
 		m.ControlBits = mustAtoi(df[2])
-		m.Multiplex.Tag = df[3]
+		tag := df[3]
+		if i := strings.IndexByte(tag, '+'); i >= 0 {
+			m.Multiplex.Tag, m.Multiplex.Tag2 = tag[:i], tag[i+1:]
+		} else {
+			m.Multiplex.Tag = tag
+		}
 	}
 
 	return m, nil
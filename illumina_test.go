@@ -86,9 +86,69 @@ func (s *S) TestParse(c *check.C) {
 				Multiplex:   Multiplex{Index: -1},
 			},
 		},
+		{ // This test is for a read carrying a UMI and a dual-indexed tag.
+			tester{"EAS139:136:FC706VJ:2:2104:15343:197393:NACGTNAC", "1:Y:18:ATCACG+TGACCA"},
+			Metadata{
+				Type:        CasavaUMI,
+				Instrument:  "EAS139",
+				Run:         136,
+				FlowCell:    "FC706VJ",
+				Lane:        2,
+				Tile:        2104,
+				Coordinate:  Coordinate{15343, 197393},
+				UMI:         "NACGTNAC",
+				Mate:        1,
+				BadRead:     true,
+				ControlBits: 18,
+				Multiplex:   Multiplex{Index: -1, Tag: "ATCACG", Tag2: "TGACCA"},
+			},
+		},
+		{ // This test is for a Casava identifier with no run id.
+			tester{"EAS139::FC706VJ:2:2104:15343:197393", ""},
+			Metadata{
+				Type:        Casava,
+				Instrument:  "EAS139",
+				Run:         -1,
+				FlowCell:    "FC706VJ",
+				Lane:        2,
+				Tile:        2104,
+				Coordinate:  Coordinate{15343, 197393},
+				Mate:        0,
+				BadRead:     false,
+				ControlBits: -1,
+				Multiplex:   Multiplex{Index: -1},
+			},
+		},
 	} {
 		m, err := Parse(t.in)
 		c.Check(err, check.Equals, nil, check.Commentf("Test %d", i))
 		c.Check(m, check.Equals, t.meta, check.Commentf("Test %d", i))
+
+		name, desc, err := m.Format()
+		c.Check(err, check.Equals, nil, check.Commentf("Test %d", i))
+		rt, err := Parse(tester{name, desc})
+		c.Check(err, check.Equals, nil, check.Commentf("Test %d", i))
+		c.Check(rt, check.Equals, m, check.Commentf("Test %d", i))
+	}
+}
+
+// Format must not produce a description with an empty tag field: a Casava
+// Metadata with Mate or ControlBits set but no valid Multiplex cannot be
+// parsed back (the trailing empty field is collapsed by casava's field
+// splitting), so it must be rejected up front instead.
+func (s *S) TestFormatRejectsMissingMultiplex(c *check.C) {
+	m := Metadata{
+		Type:        Casava,
+		Instrument:  "EAS139",
+		Run:         136,
+		FlowCell:    "FC706VJ",
+		Lane:        2,
+		Tile:        2104,
+		Coordinate:  Coordinate{15343, 197393},
+		Mate:        1,
+		ControlBits: -1,
+		Multiplex:   Multiplex{Index: -1},
 	}
+	_, _, err := m.Format()
+	c.Check(err, check.Equals, ErrBadIdentifer)
 }
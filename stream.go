@@ -0,0 +1,212 @@
+// Copyright ©2013 The bíogo.illumina Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package illumina
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/seqio/fastq"
+	"github.com/biogo/biogo/seq"
+	"github.com/biogo/biogo/seq/linear"
+)
+
+// A HistogramBy selects the key used to tally reads in Stats.Histogram.
+type HistogramBy int
+
+const (
+	// HistogramNone disables histogram collection.
+	HistogramNone HistogramBy = iota
+	// HistogramByTile tallies reads by Metadata.Tile.
+	HistogramByTile
+	// HistogramByLane tallies reads by Metadata.Lane.
+	HistogramByLane
+)
+
+// Options configures a CompressReader run.
+type Options struct {
+	// Scheme is the quality compression Scheme applied to each read. If nil,
+	// DefaultCompression is used.
+	Scheme Scheme
+
+	// Workers is the number of goroutines used to apply Scheme concurrently.
+	// Values less than 1 are treated as 1.
+	Workers int
+
+	// DropBadReads discards reads whose Metadata.BadRead is true rather than
+	// writing them to the output.
+	DropBadReads bool
+
+	// Tag, if not empty, keeps only reads whose Metadata.Multiplex.Tag is
+	// equal to Tag.
+	Tag string
+
+	// Histogram selects the key used to build Stats.Histogram. The zero
+	// value, HistogramNone, collects no histogram.
+	Histogram HistogramBy
+}
+
+// Stats summarises a CompressReader run.
+type Stats struct {
+	Read    int // Read is the number of FASTQ records consumed from the input.
+	Written int // Written is the number of records written to the output.
+	Dropped int // Dropped is the number of records filtered out by Options or whose qualities could not be compressed.
+
+	// Histogram maps the key selected by Options.Histogram — Tile or Lane —
+	// to the number of kept reads observed for that key. It is nil when
+	// Options.Histogram is HistogramNone.
+	Histogram map[int]int
+}
+
+// CompressReader reads FASTQ records from in, transparently decompressing
+// gzip input, and applies opts.Scheme to each record's qualities using a
+// pool of opts.Workers goroutines before writing the result to out as
+// FASTQ. Output order matches input order regardless of worker scheduling.
+// Each record's identifier is parsed with Parse so that records can be
+// dropped according to Options.DropBadReads and Options.Tag, and tallied
+// into the returned Stats.Histogram.
+func CompressReader(in io.Reader, out io.Writer, opts Options) (Stats, error) {
+	scheme := opts.Scheme
+	if scheme == nil {
+		scheme = DefaultCompression
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	r, err := decompress(in)
+	if err != nil {
+		return Stats{}, err
+	}
+	fr := fastq.NewReader(r, linear.NewQSeq("", nil, alphabet.DNA, alphabet.Sanger))
+	fw := fastq.NewWriter(out)
+
+	type job struct {
+		idx int
+		rec seq.Sequence
+	}
+	type outcome struct {
+		idx  int
+		rec  seq.Sequence
+		meta Metadata
+		keep bool
+	}
+
+	jobs := make(chan job, workers)
+	outcomes := make(chan outcome, workers)
+
+	// stop is closed to unwind the producer and worker goroutines if the
+	// collector below gives up early, e.g. on a write error; without it
+	// those goroutines would block forever sending to a channel nobody is
+	// still reading from.
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	cancel := func() { stopOnce.Do(func() { close(stop) }) }
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		for idx := 0; ; idx++ {
+			rec, err := fr.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+			select {
+			case jobs <- job{idx: idx, rec: rec}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				meta, _ := Parse(j.rec)
+				keep := !(opts.DropBadReads && meta.BadRead) &&
+					(opts.Tag == "" || meta.Multiplex.Tag == opts.Tag)
+				if keep {
+					if s, ok := j.rec.(seq.Scorer); ok {
+						if err := BinCompress(s, scheme); err != nil {
+							keep = false
+						}
+					}
+				}
+				select {
+				case outcomes <- outcome{idx: j.idx, rec: j.rec, meta: meta, keep: keep}:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	var stats Stats
+	if opts.Histogram != HistogramNone {
+		stats.Histogram = make(map[int]int)
+	}
+	pending := make(map[int]outcome)
+	next := 0
+	for o := range outcomes {
+		pending[o.idx] = o
+		for {
+			p, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			stats.Read++
+			if !p.keep {
+				stats.Dropped++
+				continue
+			}
+			if _, err := fw.Write(p.rec); err != nil {
+				cancel()
+				return stats, err
+			}
+			stats.Written++
+			switch opts.Histogram {
+			case HistogramByTile:
+				stats.Histogram[p.meta.Tile]++
+			case HistogramByLane:
+				stats.Histogram[int(p.meta.Lane)]++
+			}
+		}
+	}
+	if readErr != nil {
+		return stats, readErr
+	}
+	return stats, nil
+}
+
+// decompress returns a reader over r that transparently gunzips the stream
+// if it is gzip-compressed, detected via the gzip magic number.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
@@ -0,0 +1,127 @@
+// Copyright ©2013 The bíogo.illumina Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package illumina
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+// fastqRecord builds a single FASTQ record with the given identifier name
+// and description, and placeholder bases and qualities.
+func fastqRecord(name, desc string) string {
+	header := "@" + name
+	if desc != "" {
+		header += " " + desc
+	}
+	return header + "\nACGTACGTAC\n+\nIIIIIIIIII\n"
+}
+
+func (s *S) TestCompressReaderOrdering(c *check.C) {
+	var in bytes.Buffer
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("EAS139:136:FC706VJ:2:2104:15343:%d", 197000+i)
+		in.WriteString(fastqRecord(name, "1:N:0:ATCACG"))
+	}
+
+	var serial, parallel bytes.Buffer
+	_, err := CompressReader(bytes.NewReader(in.Bytes()), &serial, Options{Workers: 1})
+	c.Assert(err, check.Equals, nil)
+	_, err = CompressReader(bytes.NewReader(in.Bytes()), &parallel, Options{Workers: 8})
+	c.Assert(err, check.Equals, nil)
+	c.Check(parallel.Bytes(), check.DeepEquals, serial.Bytes())
+}
+
+func (s *S) TestCompressReaderDropBadReads(c *check.C) {
+	var in bytes.Buffer
+	in.WriteString(fastqRecord("EAS139:136:FC706VJ:2:2104:15343:197393", "1:Y:0:ATCACG"))
+	in.WriteString(fastqRecord("EAS139:136:FC706VJ:2:2104:15343:197394", "1:N:0:ATCACG"))
+
+	var out bytes.Buffer
+	stats, err := CompressReader(bytes.NewReader(in.Bytes()), &out, Options{DropBadReads: true})
+	c.Assert(err, check.Equals, nil)
+	c.Check(stats.Read, check.Equals, 2)
+	c.Check(stats.Written, check.Equals, 1)
+	c.Check(stats.Dropped, check.Equals, 1)
+	c.Check(strings.Contains(out.String(), "197394"), check.Equals, true)
+	c.Check(strings.Contains(out.String(), "197393"), check.Equals, false)
+}
+
+func (s *S) TestCompressReaderTagFilter(c *check.C) {
+	var in bytes.Buffer
+	in.WriteString(fastqRecord("EAS139:136:FC706VJ:2:2104:15343:197393", "1:N:0:ATCACG"))
+	in.WriteString(fastqRecord("EAS139:136:FC706VJ:2:2104:15343:197394", "1:N:0:TGACCA"))
+
+	var out bytes.Buffer
+	stats, err := CompressReader(bytes.NewReader(in.Bytes()), &out, Options{Tag: "TGACCA"})
+	c.Assert(err, check.Equals, nil)
+	c.Check(stats.Written, check.Equals, 1)
+	c.Check(strings.Contains(out.String(), "197394"), check.Equals, true)
+	c.Check(strings.Contains(out.String(), "197393"), check.Equals, false)
+}
+
+func (s *S) TestCompressReaderHistogram(c *check.C) {
+	var in bytes.Buffer
+	in.WriteString(fastqRecord("EAS139:136:FC706VJ:2:2104:15343:197393", "1:N:0:ATCACG"))
+	in.WriteString(fastqRecord("EAS139:136:FC706VJ:3:2105:15344:197394", "1:N:0:ATCACG"))
+
+	var out bytes.Buffer
+	stats, err := CompressReader(bytes.NewReader(in.Bytes()), &out, Options{Histogram: HistogramByLane})
+	c.Assert(err, check.Equals, nil)
+	c.Check(stats.Histogram[2], check.Equals, 1)
+	c.Check(stats.Histogram[3], check.Equals, 1)
+
+	out.Reset()
+	stats, err = CompressReader(bytes.NewReader(in.Bytes()), &out, Options{Histogram: HistogramByTile})
+	c.Assert(err, check.Equals, nil)
+	c.Check(stats.Histogram[2104], check.Equals, 1)
+	c.Check(stats.Histogram[2105], check.Equals, 1)
+}
+
+// failWriter always fails, to exercise CompressReader's error path.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errors.New("write failed") }
+
+func (s *S) TestCompressReaderWriteErrorDoesNotLeakGoroutines(c *check.C) {
+	var in bytes.Buffer
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("EAS139:136:FC706VJ:2:2104:15343:%d", 197000+i)
+		in.WriteString(fastqRecord(name, "1:N:0:ATCACG"))
+	}
+
+	before := runtime.NumGoroutine()
+	_, err := CompressReader(bytes.NewReader(in.Bytes()), failWriter{}, Options{Workers: 4})
+	c.Assert(err, check.Not(check.Equals), nil)
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	c.Check(runtime.NumGoroutine(), check.Equals, before)
+}
+
+func (s *S) TestCompressReaderGzip(c *check.C) {
+	plain := fastqRecord("EAS139:136:FC706VJ:2:2104:15343:197393", "1:N:0:ATCACG")
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write([]byte(plain))
+	c.Assert(err, check.Equals, nil)
+	c.Assert(w.Close(), check.Equals, nil)
+
+	var out bytes.Buffer
+	stats, err := CompressReader(&gz, &out, Options{})
+	c.Assert(err, check.Equals, nil)
+	c.Check(stats.Read, check.Equals, 1)
+	c.Check(strings.Contains(out.String(), "EAS139"), check.Equals, true)
+}